@@ -0,0 +1,100 @@
+package log
+
+import (
+	"io"
+	"os"
+)
+
+// CommitFunc streams size bytes read from r into a store as one
+// record and returns the number of bytes written and the position of
+// the record, as Append does. r yields exactly size bytes. Drivers
+// that back a ScratchWriter supply one to stream the staged bytes
+// into whatever they persist records to (a file, a segment, ...).
+type CommitFunc func(size int64, r io.Reader) (n uint64, pos uint64, err error)
+
+// ScratchWriter is a StoreWriter that stages a record's bytes in a
+// scratch file on disk, so a record being streamed in doesn't have to
+// fit in RAM. It's shared by the drivers that persist records to their
+// own file on disk (store/file and store/s3), which otherwise only
+// differ in how Commit streams the staged bytes into what they
+// persist to.
+type ScratchWriter struct {
+	scratch *os.File
+	size    int64
+	commit  CommitFunc
+}
+
+// NewScratchWriter creates a ScratchWriter that stages bytes in a temp
+// file named with pattern (as os.CreateTemp) and, on Commit, seeks it
+// back to the start and hands it to commit to stream into the store.
+func NewScratchWriter(pattern string, commit CommitFunc) (*ScratchWriter, error) {
+	scratch, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &ScratchWriter{scratch: scratch, commit: commit}, nil
+}
+
+// Write appends p to the writer's scratch file.
+func (w *ScratchWriter) Write(p []byte) (int, error) {
+	n, err := w.scratch.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// ReadFrom reads from r until EOF into the writer's scratch file,
+// letting io.Copy(w, r) stream straight from r rather than through an
+// intermediate buffer.
+func (w *ScratchWriter) ReadFrom(r io.Reader) (int64, error) {
+	n, err := w.scratch.ReadFrom(r)
+	w.size += n
+	return n, err
+}
+
+// Size reports the number of bytes staged so far.
+func (w *ScratchWriter) Size() int64 {
+	return w.size
+}
+
+// Cancel discards the scratch file without appending anything to the
+// store.
+func (w *ScratchWriter) Cancel() error {
+	name := w.scratch.Name()
+	if err := w.scratch.Close(); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+// Commit seeks the scratch file back to the start and streams its
+// staged bytes into the store via commit, then discards the scratch
+// file whether commit succeeds or fails, so a rejected record (for
+// example one over RecordSizeLimit) doesn't leak its scratch file.
+// It never reads the staged bytes into memory as a whole, so
+// committing a record doesn't undo the memory bound a RecordSizeLimit
+// and a resumable upload are meant to provide.
+func (w *ScratchWriter) Commit() (n uint64, pos uint64, err error) {
+	if _, err := w.scratch.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+
+	n, pos, err = w.commit(w.size, w.scratch)
+	if err != nil {
+		w.Cancel()
+		return 0, 0, err
+	}
+
+	if err := w.Cancel(); err != nil {
+		return 0, 0, err
+	}
+	return n, pos, nil
+}
+
+// Close closes the scratch file without committing or cancelling it.
+// Callers that are done with a writer should prefer Commit or Cancel,
+// which already close the scratch file.
+func (w *ScratchWriter) Close() error {
+	return w.scratch.Close()
+}
+
+var _ StoreWriter = (*ScratchWriter)(nil)
@@ -1,119 +1,176 @@
 package log
 
 import (
-	"bufio"
 	"encoding/binary"
-	"os"
-	"sync"
+	"fmt"
+	"io"
+	"time"
 )
 
-var (
-	enc = binary.BigEndian
-)
-
-// Defines the number of bytes used to store the record's length
-const (
-	lenWidth = 8
-)
-
-// store is a simple wrapper around a file.
-type store struct {
-	*os.File
-	mu   sync.Mutex
-	buf  *bufio.Writer
-	size uint64
+// Enc is the byte order used to encode a record's length prefix. All
+// Store drivers must encode and decode lengths with it so that stores
+// written by one driver can be read by another.
+var Enc = binary.BigEndian
+
+// LenWidth is the number of bytes used to store a record's length
+// ahead of the record itself.
+const LenWidth = 8
+
+// Store persists records as length-prefixed byte slices and reads them
+// back by the position Append returned. Implementations exist for
+// writing to a local file (store/file), keeping records in memory for
+// tests (store/inmemory), and buffering segments locally before
+// flushing them to S3 as immutable objects (store/s3), so the server
+// can be pointed at whichever backend a deployment needs without the
+// rest of the log layer changing.
+type Store interface {
+	// Append persists p and returns the number of bytes written and
+	// the position at which the record starts.
+	Append(p []byte) (n uint64, pos uint64, err error)
+
+	// Read returns the record stored at the given position.
+	Read(pos uint64) ([]byte, error)
+
+	// ReadAt reads len(p) bytes into p starting at the given offset,
+	// following the semantics of io.ReaderAt.
+	ReadAt(p []byte, off int64) (int, error)
+
+	// RecordSize returns the length of the record stored at pos
+	// without reading its body, so a caller can size a buffer once
+	// before calling ReadInto.
+	RecordSize(pos uint64) (uint64, error)
+
+	// ReadInto reads the record stored at pos into dst, which must be
+	// at least as large as the record, and returns the number of bytes
+	// read. It returns io.ErrShortBuffer if dst is too small. Unlike
+	// Read, it allocates no buffer for the record's body, so callers
+	// reading at high QPS can reuse dst across calls.
+	ReadInto(pos uint64, dst []byte) (n int, err error)
+
+	// NewWriter returns a handle for staging a record's bytes before
+	// appending them as a single record, so producers can stream
+	// records larger than memory and resume interrupted uploads.
+	NewWriter() (StoreWriter, error)
+
+	// OpenRecord returns a RecordReader over the record stored at pos,
+	// so callers can stream it out via io.Copy or WriteTo without
+	// reading it fully into memory first.
+	OpenRecord(pos uint64) (*RecordReader, error)
+
+	// Close persists any buffered data and releases the store's
+	// resources.
+	Close() error
 }
 
-// newStore creates a store from the given file.
-func newStore(f *os.File) (*store, error) {
-
-	// Get the file’s current size, in case we’re re-creating the store
-	// from a file that has existing data, which would happen if,
-	// for example, our service had restarted.
-	fi, err := os.Stat(f.Name())
-	if err != nil {
-		return nil, err
-	}
-	size := uint64(fi.Size())
+// StoreOptions configures the durability and size policy a Store
+// enforces. The zero value is permissive: no record size limit, no
+// background syncing, and no sync at all; buffered writes reach the
+// backing file only when the driver's own buffering flushes them.
+type StoreOptions struct {
+	// AutoSync, if non-zero, makes the store flush and sync its
+	// buffered writes on this interval, skipping the tick if nothing
+	// new was appended since the last one. Zero disables background
+	// syncing.
+	AutoSync time.Duration
+
+	// SyncOnAppend makes every Append flush and sync before it
+	// returns, trading throughput for the guarantee that an
+	// acknowledged record has survived a crash.
+	SyncOnAppend bool
+
+	// RecordSizeLimit, if non-zero, makes Append reject any payload
+	// larger than this many bytes with a *RecordTooLargeError rather
+	// than buffering it.
+	RecordSizeLimit uint64
+}
 
-	return &store{
-		File: f,
-		size: size,
-		buf:  bufio.NewWriter(f),
-	}, nil
+// RecordTooLargeError is returned by Append when a payload exceeds the
+// store's configured RecordSizeLimit.
+type RecordTooLargeError struct {
+	Size  uint64
+	Limit uint64
 }
 
-// Append persists the given bytes to the store.
-// It returns the number of bytes written and the position where the store
-// holds the record in its file.
-func (s *store) Append(p []byte) (n uint64, pos uint64, err error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	// Write the length of the record so that, when we read the record,
-	// we know how many bytes to read.
-	pos = s.size
-	if err := binary.Write(s.buf, enc, uint64(len(p))); err != nil {
-		return 0, 0, err
-	}
+func (e *RecordTooLargeError) Error() string {
+	return fmt.Sprintf("log: record of %d bytes exceeds the %d byte limit", e.Size, e.Limit)
+}
 
-	// We write to the buffered writer instead of directly to the file to
-	// reduce the number of system calls and improve performance.
-	w, err := s.buf.Write(p)
-	if err != nil {
-		return 0, 0, err
+// CheckRecordSize returns a *RecordTooLargeError if size is larger
+// than limit. A limit of zero means unlimited, so every size passes.
+// It takes the size rather than the record itself so a streaming
+// writer can reject an oversized record before reading its body.
+func CheckRecordSize(size uint64, limit uint64) error {
+	if limit != 0 && size > limit {
+		return &RecordTooLargeError{Size: size, Limit: limit}
 	}
-	w += lenWidth
-	s.size += uint64(w)
-
-	return uint64(w), pos, nil
+	return nil
 }
 
-// Read returns the record stored at the given position.
-func (s *store) Read(pos uint64) ([]byte, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	// First it flushes the writer buffer, in case we're about to try
-	// to read a record that the buffer hasn't flushed to disk yet.
-	if err := s.buf.Flush(); err != nil {
-		return nil, err
-	}
-	// We find out how many bytes we have to read to get the whole
-	// record.
-	size := make([]byte, lenWidth)
-	if _, err := s.File.ReadAt(size, int64(pos)); err != nil {
-		return nil, err
-	}
-	// We fetch the record.
-	b := make([]byte, enc.Uint64(size))
-	if _, err := s.File.ReadAt(b, int64(pos+lenWidth)); err != nil {
-		return nil, err
-	}
+// StoreWriter stages a record's bytes until Commit appends them to the
+// store as a single record with one length prefix. It lets a producer
+// stream a record larger than memory and, since nothing is written to
+// the store until Commit, resume after a disconnect by simply opening
+// a new writer without leaving partial framing behind. It implements
+// io.ReaderFrom so io.Copy(w, src) can stream straight from src (for
+// example an HTTP request body) into the staged bytes without an
+// intermediate buffer.
+type StoreWriter interface {
+	io.Writer
+	io.ReaderFrom
+
+	// Size reports the number of bytes staged so far.
+	Size() int64
+
+	// Cancel discards the staged bytes without appending anything to
+	// the store.
+	Cancel() error
+
+	// Commit appends the staged bytes to the store as one record and
+	// returns the number of bytes written and the position of the
+	// record, as Append does.
+	Commit() (n uint64, pos uint64, err error)
+
+	// Close releases the writer's resources without committing or
+	// cancelling the staged bytes.
+	Close() error
+}
 
-	return b, nil
+// RecordReader streams a single record's body and implements
+// io.WriterTo, so io.Copy(w, reader) lets io.Copy skip its own buffer
+// and copy straight from the underlying source to w.
+type RecordReader struct {
+	r    io.Reader
+	size uint64
 }
 
-// ReadAt reads len(p) bytes into "p" beginning at the "off" offset in the store's file.
-func (s *store) ReadAt(p []byte, off int64) (int, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// NewRecordReader wraps r, which must yield exactly size bytes, as a
+// RecordReader. Store drivers call this from OpenRecord; callers
+// don't construct a RecordReader directly.
+func NewRecordReader(r io.Reader, size uint64) *RecordReader {
+	return &RecordReader{r: r, size: size}
+}
 
-	if err := s.buf.Flush(); err != nil {
-		return 0, err
-	}
+// Size reports the record's length.
+func (rr *RecordReader) Size() uint64 {
+	return rr.size
+}
 
-	return s.File.ReadAt(p, off)
+// Read implements io.Reader.
+func (rr *RecordReader) Read(p []byte) (int, error) {
+	return rr.r.Read(p)
 }
 
-// Close persists any buffered data before closing the file.
-func (s *store) Close() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// WriteTo implements io.WriterTo by copying straight from the
+// underlying source to w.
+func (rr *RecordReader) WriteTo(w io.Writer) (int64, error) {
+	return io.Copy(w, rr.r)
+}
 
-	if err := s.buf.Flush(); err != nil {
-		return err
+// Close releases the underlying source if it needs releasing, such as
+// an HTTP response body backing a record read from S3.
+func (rr *RecordReader) Close() error {
+	if c, ok := rr.r.(io.Closer); ok {
+		return c.Close()
 	}
-
-	return s.File.Close()
+	return nil
 }
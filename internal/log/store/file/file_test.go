@@ -0,0 +1,476 @@
+package file
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/mroobert/proglog/internal/log"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+var (
+	write = []byte("hello world")
+	width = uint64(len(write)) + log.LenWidth
+)
+
+func TestStore(t *testing.T) {
+
+	t.Run("testAppendRead", testAppendRead)
+	t.Run("testClose", testClose)
+}
+
+func testAppendRead(t *testing.T) {
+	f, err := ioutil.TempFile("", "store_append_read_test")
+	if err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error when creating temp file.", failed)
+	}
+	defer os.Remove(f.Name())
+
+	s, err := NewStore(f, log.StoreOptions{})
+	if err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error when creating a store.", failed)
+	}
+
+	testAppend(t, s)
+	testRead(t, s)
+	testReadAt(t, s)
+	testReadInto(t, s)
+	testOpenRecord(t, s)
+
+	// We create the store again and we test reading from it again, to verify
+	// that our service will recover its state after restart.
+	s, err = NewStore(f, log.StoreOptions{})
+	if err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error when creating the store again.", failed)
+	}
+	testRead(t, s)
+}
+
+func testAppend(t *testing.T, s *Store) {
+	t.Helper()
+
+	t.Log("Given the need to append a record to the store.")
+	{
+		for i := uint64(1); i < 4; i++ {
+			t.Logf("\t\tTest %d:\t When appending a new record:", i)
+			{
+				n, pos, err := s.Append(write)
+
+				if err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error: %s", failed, err.Error())
+				}
+				t.Logf("\t\t\t%s Should expect no error.", success)
+
+				if pos+n != width*i {
+					t.Fatalf("\t\t\t%s Should expect record to be appended.", failed)
+				}
+				t.Logf("\t\t\t%s Should expect record to be appended.", success)
+			}
+		}
+	}
+}
+
+func testRead(t *testing.T, s *Store) {
+	t.Helper()
+
+	t.Log("Given the need to read a record from the store.")
+	{
+
+		var pos uint64
+		for i := uint64(1); i < 4; i++ {
+			t.Logf("\t\tTest %d:\t When reading a record from the store:", i)
+			{
+				read, err := s.Read(pos)
+
+				if err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error: %s", failed, err.Error())
+				}
+				t.Logf("\t\t\t%s Should expect no error.", success)
+
+				cmp := bytes.Compare(write, read)
+				if cmp != 0 {
+					t.Fatalf("\t\t\t%s Should expect: \"%s\" got: \"%s\"", failed, string(write), string(read))
+				}
+				t.Logf("\t\t\t%s Should read the expected record.", success)
+
+				pos += width
+			}
+		}
+	}
+}
+
+func testReadAt(t *testing.T, s *Store) {
+	t.Helper()
+
+	t.Log("Given the need to read a sequence of bytes from a specific offset.")
+	{
+		for i, off := uint64(1), int64(0); i < 4; i++ {
+			t.Logf("\t\tTest %d:\t When reading a sequence:", i)
+			{
+
+				b := make([]byte, log.LenWidth)
+				n, err := s.ReadAt(b, off)
+
+				if err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error: %s", failed, err.Error())
+				}
+				t.Logf("\t\t\t%s Should expect no error.", success)
+
+				if log.LenWidth != n {
+					t.Fatalf("\t\t\t%s Should expect %d bytes to be read but got %d", failed, log.LenWidth, n)
+				}
+				size := log.Enc.Uint64(b)
+				t.Logf("\t\t\t%s Should expect %d bytes to be read, value: %d", success, log.LenWidth, size)
+				off += int64(n)
+
+				b = make([]byte, size)
+				n, err = s.ReadAt(b, off)
+
+				if err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error: %s", failed, err.Error())
+				}
+				t.Logf("\t\t\t%s Should expect no error.", success)
+
+				cmp := bytes.Compare(write, b)
+				if cmp != 0 {
+					t.Fatalf("\t\t\t%s Should expect %s to be read: got %s", failed, string(write), string(b))
+				}
+				t.Logf("\t\t\t%s Should expect %s to be read", success, string(write))
+
+				if int(size) != n {
+					t.Fatalf("\t\t\t%s Should expect %s to be read.", failed, string(write))
+				}
+				off += int64(n)
+			}
+		}
+	}
+}
+
+func testReadInto(t *testing.T, s *Store) {
+	t.Helper()
+
+	t.Log("Given the need to read a record into a caller-supplied buffer.")
+	{
+		var pos uint64
+		for i := uint64(1); i < 4; i++ {
+			t.Logf("\t\tTest %d:\t When sizing a buffer with RecordSize and reading into it:", i)
+			{
+				size, err := s.RecordSize(pos)
+				if err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error: %s", failed, err.Error())
+				}
+				if size != uint64(len(write)) {
+					t.Fatalf("\t\t\t%s Should expect RecordSize to report %d, got %d", failed, len(write), size)
+				}
+				t.Logf("\t\t\t%s Should expect RecordSize to match the record's length.", success)
+
+				dst := make([]byte, size)
+				n, err := s.ReadInto(pos, dst)
+				if err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error: %s", failed, err.Error())
+				}
+				if bytes.Compare(write, dst[:n]) != 0 {
+					t.Fatalf("\t\t\t%s Should expect: \"%s\" got: \"%s\"", failed, string(write), string(dst[:n]))
+				}
+				t.Logf("\t\t\t%s Should read the expected record into dst.", success)
+
+				if _, err := s.ReadInto(pos, make([]byte, size-1)); !errors.Is(err, io.ErrShortBuffer) {
+					t.Fatalf("\t\t\t%s Should expect io.ErrShortBuffer for a dst that's too small, got %v", failed, err)
+				}
+				t.Logf("\t\t\t%s Should expect io.ErrShortBuffer for a dst that's too small.", success)
+
+				pos += width
+			}
+		}
+	}
+}
+
+func testOpenRecord(t *testing.T, s *Store) {
+	t.Helper()
+
+	t.Log("Given the need to stream a record out without reading it fully into memory.")
+	{
+		var pos uint64
+		for i := uint64(1); i < 4; i++ {
+			t.Logf("\t\tTest %d:\t When opening and writing out a record:", i)
+			{
+				rr, err := s.OpenRecord(pos)
+				if err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error: %s", failed, err.Error())
+				}
+				t.Logf("\t\t\t%s Should expect no error.", success)
+
+				if rr.Size() != uint64(len(write)) {
+					t.Fatalf("\t\t\t%s Should expect Size to report %d, got %d", failed, len(write), rr.Size())
+				}
+				t.Logf("\t\t\t%s Should expect Size to match the record's length.", success)
+
+				var buf bytes.Buffer
+				n, err := rr.WriteTo(&buf)
+				if err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error when writing out: %s", failed, err.Error())
+				}
+				if n != int64(len(write)) {
+					t.Fatalf("\t\t\t%s Should expect %d bytes written, got %d", failed, len(write), n)
+				}
+				if bytes.Compare(write, buf.Bytes()) != 0 {
+					t.Fatalf("\t\t\t%s Should expect: \"%s\" got: \"%s\"", failed, string(write), buf.String())
+				}
+				t.Logf("\t\t\t%s Should write out the expected record.", success)
+
+				if err := rr.Close(); err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error when closing: %s", failed, err.Error())
+				}
+				t.Logf("\t\t\t%s Should expect no error when closing.", success)
+
+				pos += width
+			}
+		}
+	}
+}
+
+func testClose(t *testing.T) {
+	f, err := ioutil.TempFile("", "store_close_test")
+	if err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error when creating temp file.", failed)
+	}
+	defer os.Remove(f.Name())
+
+	s, err := NewStore(f, log.StoreOptions{})
+	if err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error when creating a store.", failed)
+	}
+
+	_, _, err = s.Append(write)
+	if err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error when appending to store: %s", failed, err.Error())
+	}
+
+	f, beforeSize, err := openFile(f.Name())
+	if err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error when retrieving the store file size: %s", failed, err.Error())
+	}
+
+	t.Log("Given the need to close the store.")
+	{
+		testID := 1
+		t.Logf("\t\tTest %d:\t When closing the store:", testID)
+		{
+			err := s.Close()
+			if err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error: %s", failed, err.Error())
+			}
+			t.Logf("\t\t\t%s Should expect no error.", success)
+
+			_, afterSize, err := openFile(f.Name())
+			if err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error when retrieving the store file size after closing & re-open: %s", failed, err.Error())
+			}
+			t.Logf("\t\t\t%s Should expect no error when retrieving the store file size after closing & re-open.", success)
+			if !(afterSize > beforeSize) {
+				t.Fatalf("\t\t\t%s Should expect the file to have grown after closing & re-open: before %d, after %d", failed, beforeSize, afterSize)
+			}
+			t.Logf("\t\t\t%s Should expect the file to have grown after closing & re-open.", success)
+		}
+	}
+}
+
+func TestStoreWriter(t *testing.T) {
+
+	t.Run("testWriterCommit", testWriterCommit)
+	t.Run("testWriterCancel", testWriterCancel)
+}
+
+func testWriterCommit(t *testing.T) {
+	f, err := ioutil.TempFile("", "store_writer_commit_test")
+	if err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error when creating temp file.", failed)
+	}
+	defer os.Remove(f.Name())
+
+	s, err := NewStore(f, log.StoreOptions{})
+	if err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error when creating a store.", failed)
+	}
+
+	t.Log("Given the need to stream a record into the store in chunks.")
+	{
+		testID := 1
+		t.Logf("\t\tTest %d:\t When writing chunks and committing:", testID)
+		{
+			w, err := s.NewWriter()
+			if err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error when creating a writer: %s", failed, err.Error())
+			}
+			t.Logf("\t\t\t%s Should expect no error when creating a writer.", success)
+
+			for _, chunk := range bytes.SplitAfter(write, []byte(" ")) {
+				if _, err := w.Write(chunk); err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error when writing a chunk: %s", failed, err.Error())
+				}
+			}
+			if w.Size() != int64(len(write)) {
+				t.Fatalf("\t\t\t%s Should expect the staged size to match the written bytes.", failed)
+			}
+			t.Logf("\t\t\t%s Should expect the staged size to match the written bytes.", success)
+
+			n, pos, err := w.Commit()
+			if err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error when committing: %s", failed, err.Error())
+			}
+			t.Logf("\t\t\t%s Should expect no error when committing.", success)
+
+			if n != width || pos != 0 {
+				t.Fatalf("\t\t\t%s Should expect the committed record to be appended as a single record.", failed)
+			}
+			t.Logf("\t\t\t%s Should expect the committed record to be appended as a single record.", success)
+
+			read, err := s.Read(pos)
+			if err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error when reading back the record: %s", failed, err.Error())
+			}
+			if bytes.Compare(write, read) != 0 {
+				t.Fatalf("\t\t\t%s Should expect: \"%s\" got: \"%s\"", failed, string(write), string(read))
+			}
+			t.Logf("\t\t\t%s Should read back the committed record.", success)
+		}
+	}
+}
+
+func testWriterCancel(t *testing.T) {
+	f, err := ioutil.TempFile("", "store_writer_cancel_test")
+	if err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error when creating temp file.", failed)
+	}
+	defer os.Remove(f.Name())
+
+	s, err := NewStore(f, log.StoreOptions{})
+	if err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error when creating a store.", failed)
+	}
+
+	t.Log("Given the need to abandon a partially staged record.")
+	{
+		testID := 1
+		t.Logf("\t\tTest %d:\t When cancelling a writer:", testID)
+		{
+			w, err := s.NewWriter()
+			if err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error when creating a writer: %s", failed, err.Error())
+			}
+			if _, err := w.Write(write); err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error when writing: %s", failed, err.Error())
+			}
+
+			if err := w.Cancel(); err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error when cancelling: %s", failed, err.Error())
+			}
+			t.Logf("\t\t\t%s Should expect no error when cancelling.", success)
+
+			if s.size != 0 {
+				t.Fatalf("\t\t\t%s Should expect nothing to have been appended to the store.", failed)
+			}
+			t.Logf("\t\t\t%s Should expect nothing to have been appended to the store.", success)
+		}
+	}
+}
+
+func TestStoreOptions(t *testing.T) {
+
+	t.Run("testRecordSizeLimit", testRecordSizeLimit)
+	t.Run("testSyncOnAppend", testSyncOnAppend)
+}
+
+func testRecordSizeLimit(t *testing.T) {
+	f, err := ioutil.TempFile("", "store_record_size_limit_test")
+	if err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error when creating temp file.", failed)
+	}
+	defer os.Remove(f.Name())
+
+	s, err := NewStore(f, log.StoreOptions{RecordSizeLimit: uint64(len(write)) - 1})
+	if err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error when creating a store.", failed)
+	}
+
+	t.Log("Given the need to reject records larger than the configured limit.")
+	{
+		testID := 1
+		t.Logf("\t\tTest %d:\t When appending a record over the limit:", testID)
+		{
+			_, _, err := s.Append(write)
+
+			var tooLarge *log.RecordTooLargeError
+			if !errors.As(err, &tooLarge) {
+				t.Fatalf("\t\t\t%s Should expect a *log.RecordTooLargeError, got: %v", failed, err)
+			}
+			t.Logf("\t\t\t%s Should expect a *log.RecordTooLargeError.", success)
+
+			if s.size != 0 {
+				t.Fatalf("\t\t\t%s Should expect nothing to have been written to the store.", failed)
+			}
+			t.Logf("\t\t\t%s Should expect nothing to have been written to the store.", success)
+		}
+	}
+}
+
+func testSyncOnAppend(t *testing.T) {
+	f, err := ioutil.TempFile("", "store_sync_on_append_test")
+	if err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error when creating temp file.", failed)
+	}
+	defer os.Remove(f.Name())
+
+	s, err := NewStore(f, log.StoreOptions{SyncOnAppend: true})
+	if err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error when creating a store.", failed)
+	}
+
+	t.Log("Given the need to persist every record as soon as it's appended.")
+	{
+		testID := 1
+		t.Logf("\t\tTest %d:\t When appending with SyncOnAppend enabled:", testID)
+		{
+			if _, _, err := s.Append(write); err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error: %s", failed, err.Error())
+			}
+			t.Logf("\t\t\t%s Should expect no error.", success)
+
+			fi, err := os.Stat(f.Name())
+			if err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error when statting the file: %s", failed, err.Error())
+			}
+			if uint64(fi.Size()) != width {
+				t.Fatalf("\t\t\t%s Should expect the record to already be on disk without a Close or Flush.", failed)
+			}
+			t.Logf("\t\t\t%s Should expect the record to already be on disk without a Close or Flush.", success)
+		}
+	}
+}
+
+func openFile(name string) (*os.File, int64, error) {
+	f, err := os.OpenFile(
+		name,
+		os.O_RDWR|os.O_CREATE|os.O_APPEND,
+		0644,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return f, fi.Size(), nil
+}
@@ -0,0 +1,203 @@
+// Package inmemory implements log.Store on top of a plain byte slice,
+// so tests can exercise the store without touching the filesystem.
+package inmemory
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/mroobert/proglog/internal/log"
+)
+
+// Store keeps every record in a single in-memory buffer.
+type Store struct {
+	mu              sync.Mutex
+	buf             []byte
+	recordSizeLimit uint64
+}
+
+var _ log.Store = (*Store)(nil)
+
+// NewStore creates an empty in-memory store. Only opts.RecordSizeLimit
+// applies here: there's no file to fsync, so AutoSync and
+// SyncOnAppend are ignored.
+func NewStore(opts log.StoreOptions) *Store {
+	return &Store{recordSizeLimit: opts.RecordSizeLimit}
+}
+
+// Append persists the given bytes to the store.
+// It returns the number of bytes written and the position where the store
+// holds the record.
+func (s *Store) Append(p []byte) (n uint64, pos uint64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.appendLocked(p)
+}
+
+// appendLocked appends the length-prefixed record to buf. Callers must
+// hold s.mu.
+func (s *Store) appendLocked(p []byte) (n uint64, pos uint64, err error) {
+	if err := log.CheckRecordSize(uint64(len(p)), s.recordSizeLimit); err != nil {
+		return 0, 0, err
+	}
+
+	pos = uint64(len(s.buf))
+
+	header := make([]byte, log.LenWidth)
+	log.Enc.PutUint64(header, uint64(len(p)))
+	s.buf = append(s.buf, header...)
+	s.buf = append(s.buf, p...)
+
+	return uint64(log.LenWidth + len(p)), pos, nil
+}
+
+// Read returns the record stored at the given position.
+func (s *Store) Read(pos uint64) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size, start, err := s.recordBoundsLocked(pos)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, size)
+	copy(b, s.buf[start:start+size])
+	return b, nil
+}
+
+// RecordSize returns the length of the record stored at pos without
+// copying its body.
+func (s *Store) RecordSize(pos uint64) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size, _, err := s.recordBoundsLocked(pos)
+	return size, err
+}
+
+// recordBoundsLocked returns the length of the record stored at pos
+// and the offset its body starts at in buf. Callers must hold s.mu.
+func (s *Store) recordBoundsLocked(pos uint64) (size uint64, start uint64, err error) {
+	if pos+log.LenWidth > uint64(len(s.buf)) {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	size = log.Enc.Uint64(s.buf[pos : pos+log.LenWidth])
+
+	start = pos + log.LenWidth
+	if start+size > uint64(len(s.buf)) {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	return size, start, nil
+}
+
+// ReadInto reads the record stored at pos into dst, which must be at
+// least as large as the record, rather than allocating a fresh slice
+// on every call the way Read does.
+func (s *Store) ReadInto(pos uint64, dst []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size, start, err := s.recordBoundsLocked(pos)
+	if err != nil {
+		return 0, err
+	}
+	if uint64(len(dst)) < size {
+		return 0, io.ErrShortBuffer
+	}
+
+	return copy(dst[:size], s.buf[start:start+size]), nil
+}
+
+// OpenRecord returns a log.RecordReader over the record stored at pos.
+func (s *Store) OpenRecord(pos uint64) (*log.RecordReader, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size, start, err := s.recordBoundsLocked(pos)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, size)
+	copy(b, s.buf[start:start+size])
+	return log.NewRecordReader(bytes.NewReader(b), size), nil
+}
+
+// ReadAt reads len(p) bytes into "p" beginning at the "off" offset in the store's buffer.
+func (s *Store) ReadAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if off < 0 || off >= int64(len(s.buf)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, s.buf[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Close is a no-op: an in-memory store has nothing to flush or release.
+func (s *Store) Close() error {
+	return nil
+}
+
+// writer stages a record's bytes in memory until Commit appends them
+// to the store.
+type writer struct {
+	store *Store
+	buf   bytes.Buffer
+}
+
+// NewWriter returns a log.StoreWriter that stages a new record's bytes
+// in memory until the caller calls Commit.
+func (s *Store) NewWriter() (log.StoreWriter, error) {
+	return &writer{store: s}, nil
+}
+
+// Write appends p to the writer's buffer.
+func (w *writer) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+// ReadFrom reads from r until EOF into the writer's buffer, letting
+// io.Copy(w, r) stream straight from r rather than through an
+// intermediate buffer of its own.
+func (w *writer) ReadFrom(r io.Reader) (int64, error) {
+	return w.buf.ReadFrom(r)
+}
+
+// Size reports the number of bytes staged so far.
+func (w *writer) Size() int64 {
+	return int64(w.buf.Len())
+}
+
+// Cancel discards the staged bytes without appending anything to the
+// store.
+func (w *writer) Cancel() error {
+	w.buf.Reset()
+	return nil
+}
+
+// Commit appends the staged bytes to the store as one record.
+func (w *writer) Commit() (n uint64, pos uint64, err error) {
+	w.store.mu.Lock()
+	n, pos, err = w.store.appendLocked(w.buf.Bytes())
+	w.store.mu.Unlock()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	w.buf.Reset()
+	return n, pos, nil
+}
+
+// Close is a no-op: the writer holds no resources besides its buffer.
+func (w *writer) Close() error {
+	return nil
+}
@@ -0,0 +1,264 @@
+package inmemory
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/mroobert/proglog/internal/log"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+var (
+	write = []byte("hello world")
+	width = uint64(len(write)) + log.LenWidth
+)
+
+func TestStore(t *testing.T) {
+	t.Run("testAppendRead", testAppendRead)
+}
+
+func testAppendRead(t *testing.T) {
+	s := NewStore(log.StoreOptions{})
+
+	testAppend(t, s)
+	testRead(t, s)
+	testReadInto(t, s)
+	testOpenRecord(t, s)
+}
+
+func testAppend(t *testing.T, s *Store) {
+	t.Helper()
+
+	t.Log("Given the need to append a record to the store.")
+	{
+		for i := uint64(1); i < 4; i++ {
+			t.Logf("\t\tTest %d:\t When appending a new record:", i)
+			{
+				n, pos, err := s.Append(write)
+				if err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error: %s", failed, err.Error())
+				}
+				t.Logf("\t\t\t%s Should expect no error.", success)
+
+				if pos+n != width*i {
+					t.Fatalf("\t\t\t%s Should expect record to be appended.", failed)
+				}
+				t.Logf("\t\t\t%s Should expect record to be appended.", success)
+			}
+		}
+	}
+}
+
+func testRead(t *testing.T, s *Store) {
+	t.Helper()
+
+	t.Log("Given the need to read a record from the store.")
+	{
+		var pos uint64
+		for i := uint64(1); i < 4; i++ {
+			t.Logf("\t\tTest %d:\t When reading a record from the store:", i)
+			{
+				read, err := s.Read(pos)
+				if err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error: %s", failed, err.Error())
+				}
+				t.Logf("\t\t\t%s Should expect no error.", success)
+
+				if bytes.Compare(write, read) != 0 {
+					t.Fatalf("\t\t\t%s Should expect: \"%s\" got: \"%s\"", failed, string(write), string(read))
+				}
+				t.Logf("\t\t\t%s Should read the expected record.", success)
+
+				pos += width
+			}
+		}
+	}
+}
+
+func testReadInto(t *testing.T, s *Store) {
+	t.Helper()
+
+	t.Log("Given the need to read a record into a caller-supplied buffer.")
+	{
+		var pos uint64
+		for i := uint64(1); i < 4; i++ {
+			t.Logf("\t\tTest %d:\t When sizing a buffer with RecordSize and reading into it:", i)
+			{
+				size, err := s.RecordSize(pos)
+				if err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error: %s", failed, err.Error())
+				}
+				if size != uint64(len(write)) {
+					t.Fatalf("\t\t\t%s Should expect RecordSize to report %d, got %d", failed, len(write), size)
+				}
+				t.Logf("\t\t\t%s Should expect RecordSize to match the record's length.", success)
+
+				dst := make([]byte, size)
+				n, err := s.ReadInto(pos, dst)
+				if err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error: %s", failed, err.Error())
+				}
+				if bytes.Compare(write, dst[:n]) != 0 {
+					t.Fatalf("\t\t\t%s Should expect: \"%s\" got: \"%s\"", failed, string(write), string(dst[:n]))
+				}
+				t.Logf("\t\t\t%s Should read the expected record into dst.", success)
+
+				if _, err := s.ReadInto(pos, make([]byte, size-1)); !errors.Is(err, io.ErrShortBuffer) {
+					t.Fatalf("\t\t\t%s Should expect io.ErrShortBuffer for a dst that's too small, got %v", failed, err)
+				}
+				t.Logf("\t\t\t%s Should expect io.ErrShortBuffer for a dst that's too small.", success)
+
+				pos += width
+			}
+		}
+	}
+}
+
+func testOpenRecord(t *testing.T, s *Store) {
+	t.Helper()
+
+	t.Log("Given the need to stream a record out without reading it fully into memory.")
+	{
+		var pos uint64
+		for i := uint64(1); i < 4; i++ {
+			t.Logf("\t\tTest %d:\t When opening and writing out a record:", i)
+			{
+				rr, err := s.OpenRecord(pos)
+				if err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error: %s", failed, err.Error())
+				}
+				t.Logf("\t\t\t%s Should expect no error.", success)
+
+				var buf bytes.Buffer
+				n, err := rr.WriteTo(&buf)
+				if err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error when writing out: %s", failed, err.Error())
+				}
+				if n != int64(len(write)) {
+					t.Fatalf("\t\t\t%s Should expect %d bytes written, got %d", failed, len(write), n)
+				}
+				if bytes.Compare(write, buf.Bytes()) != 0 {
+					t.Fatalf("\t\t\t%s Should expect: \"%s\" got: \"%s\"", failed, string(write), buf.String())
+				}
+				t.Logf("\t\t\t%s Should write out the expected record.", success)
+
+				pos += width
+			}
+		}
+	}
+}
+
+func TestStoreWriter(t *testing.T) {
+	t.Run("testWriterCommit", testWriterCommit)
+	t.Run("testWriterCancel", testWriterCancel)
+}
+
+func testWriterCommit(t *testing.T) {
+	s := NewStore(log.StoreOptions{})
+
+	t.Log("Given the need to stream a record into the store in chunks.")
+	{
+		testID := 1
+		t.Logf("\t\tTest %d:\t When writing chunks and committing:", testID)
+		{
+			w, err := s.NewWriter()
+			if err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error when creating a writer: %s", failed, err.Error())
+			}
+
+			for _, chunk := range bytes.SplitAfter(write, []byte(" ")) {
+				if _, err := w.Write(chunk); err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error when writing a chunk: %s", failed, err.Error())
+				}
+			}
+			if w.Size() != int64(len(write)) {
+				t.Fatalf("\t\t\t%s Should expect the staged size to match the written bytes.", failed)
+			}
+			t.Logf("\t\t\t%s Should expect the staged size to match the written bytes.", success)
+
+			n, pos, err := w.Commit()
+			if err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error when committing: %s", failed, err.Error())
+			}
+			t.Logf("\t\t\t%s Should expect no error when committing.", success)
+
+			if n != width || pos != 0 {
+				t.Fatalf("\t\t\t%s Should expect the committed record to be appended as a single record.", failed)
+			}
+			t.Logf("\t\t\t%s Should expect the committed record to be appended as a single record.", success)
+
+			read, err := s.Read(pos)
+			if err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error when reading back the record: %s", failed, err.Error())
+			}
+			if bytes.Compare(write, read) != 0 {
+				t.Fatalf("\t\t\t%s Should expect: \"%s\" got: \"%s\"", failed, string(write), string(read))
+			}
+			t.Logf("\t\t\t%s Should read back the committed record.", success)
+		}
+	}
+}
+
+func testWriterCancel(t *testing.T) {
+	s := NewStore(log.StoreOptions{})
+
+	t.Log("Given the need to abandon a partially staged record.")
+	{
+		testID := 1
+		t.Logf("\t\tTest %d:\t When cancelling a writer:", testID)
+		{
+			w, err := s.NewWriter()
+			if err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error when creating a writer: %s", failed, err.Error())
+			}
+			if _, err := w.Write(write); err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error when writing: %s", failed, err.Error())
+			}
+
+			if err := w.Cancel(); err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error when cancelling: %s", failed, err.Error())
+			}
+			t.Logf("\t\t\t%s Should expect no error when cancelling.", success)
+
+			if len(s.buf) != 0 {
+				t.Fatalf("\t\t\t%s Should expect nothing to have been appended to the store.", failed)
+			}
+			t.Logf("\t\t\t%s Should expect nothing to have been appended to the store.", success)
+		}
+	}
+}
+
+func TestStoreOptions(t *testing.T) {
+	t.Run("testRecordSizeLimit", testRecordSizeLimit)
+}
+
+func testRecordSizeLimit(t *testing.T) {
+	s := NewStore(log.StoreOptions{RecordSizeLimit: uint64(len(write)) - 1})
+
+	t.Log("Given the need to reject records larger than the configured limit.")
+	{
+		testID := 1
+		t.Logf("\t\tTest %d:\t When appending a record over the limit:", testID)
+		{
+			_, _, err := s.Append(write)
+
+			var tooLarge *log.RecordTooLargeError
+			if !errors.As(err, &tooLarge) {
+				t.Fatalf("\t\t\t%s Should expect a *log.RecordTooLargeError, got: %v", failed, err)
+			}
+			t.Logf("\t\t\t%s Should expect a *log.RecordTooLargeError.", success)
+
+			if len(s.buf) != 0 {
+				t.Fatalf("\t\t\t%s Should expect nothing to have been written to the store.", failed)
+			}
+			t.Logf("\t\t\t%s Should expect nothing to have been written to the store.", success)
+		}
+	}
+}
@@ -0,0 +1,650 @@
+// Package s3 implements log.Store by buffering the active segment on
+// local disk and flushing it to an object store as one immutable
+// object whenever it reaches SegmentMaxBytes, so proglog can be
+// deployed against S3 (or anything that speaks the same small
+// interface) without rewriting the log layer.
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mroobert/proglog/internal/log"
+)
+
+// ErrNotFound is the error GetObjectRange must return when key doesn't
+// exist, so callers like loadManifest can tell a keyPrefix that has
+// never been rotated before apart from a real failure.
+var ErrNotFound = errors.New("s3 store: object not found")
+
+// Uploader is the subset of an S3-compatible client the store needs:
+// enough to flush a finished segment as one object and to read a byte
+// range back out of it. Callers wire in their own implementation (for
+// example one backed by the AWS SDK) so this package stays free of
+// any particular client dependency.
+type Uploader interface {
+	// PutObject uploads size bytes read from r as the object named key.
+	PutObject(key string, r io.Reader, size int64) error
+
+	// GetObjectRange returns the length bytes of the object named key
+	// starting at offset. It returns ErrNotFound if key doesn't exist.
+	GetObjectRange(key string, offset, length int64) (io.ReadCloser, error)
+}
+
+// segment describes one immutable object already flushed to the
+// uploader.
+type segment struct {
+	key  string
+	base uint64
+	size int64
+}
+
+// maxManifestBytes bounds the single ranged read loadManifest issues
+// for the manifest object. The manifest is just a sequence of small
+// (key, base, size) tuples, so this is far more than any realistic
+// segment count needs.
+const maxManifestBytes = 1 << 20
+
+// manifestKey names the object NewStore and rotateLocked use to
+// persist and reload keyPrefix's flushed segment index.
+func manifestKey(keyPrefix string) string {
+	return keyPrefix + "-manifest"
+}
+
+// encodeManifest serializes segments as the sequence of (base, size,
+// key) tuples loadManifest decodes back.
+func encodeManifest(segments []segment) []byte {
+	var buf bytes.Buffer
+	for _, seg := range segments {
+		header := make([]byte, 18)
+		log.Enc.PutUint64(header[0:8], seg.base)
+		log.Enc.PutUint64(header[8:16], uint64(seg.size))
+		log.Enc.PutUint16(header[16:18], uint16(len(seg.key)))
+		buf.Write(header)
+		buf.WriteString(seg.key)
+	}
+	return buf.Bytes()
+}
+
+// decodeManifest is encodeManifest's inverse.
+func decodeManifest(b []byte) ([]segment, error) {
+	var segments []segment
+	for len(b) > 0 {
+		if len(b) < 18 {
+			return nil, fmt.Errorf("s3 store: truncated manifest header")
+		}
+		base := log.Enc.Uint64(b[0:8])
+		size := int64(log.Enc.Uint64(b[8:16]))
+		keyLen := int(log.Enc.Uint16(b[16:18]))
+		b = b[18:]
+
+		if len(b) < keyLen {
+			return nil, fmt.Errorf("s3 store: truncated manifest key")
+		}
+		key := string(b[:keyLen])
+		b = b[keyLen:]
+
+		segments = append(segments, segment{key: key, base: base, size: size})
+	}
+	return segments, nil
+}
+
+// loadManifest reads back the segment index a previous process's
+// rotateLocked persisted for keyPrefix, so NewStore can resume
+// appending and rotating where that process left off instead of
+// starting from an empty index that would make every already-flushed
+// segment unreadable and the next rotation reuse (and overwrite) its
+// object key. A keyPrefix that has never been rotated before has no
+// manifest object yet, which isn't an error.
+func loadManifest(up Uploader, keyPrefix string) ([]segment, error) {
+	r, err := up.GetObjectRange(manifestKey(keyPrefix), 0, maxManifestBytes)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return decodeManifest(b)
+}
+
+// localFile wraps the active segment's backing file with a reference
+// count of the OpenRecord readers still streaming from it. rotateLocked
+// retires the file instead of closing and removing it outright, so an
+// in-flight read started before a rotation doesn't end up reading from
+// a closed, deleted file.
+type localFile struct {
+	f    *os.File
+	name string
+
+	mu       sync.Mutex
+	refs     int
+	retiring bool
+}
+
+// newLocalFile creates a fresh scratch file to buffer a segment in.
+func newLocalFile() (*localFile, error) {
+	f, err := os.CreateTemp("", "s3store-segment-*")
+	if err != nil {
+		return nil, err
+	}
+	return &localFile{f: f, name: f.Name()}, nil
+}
+
+// acquire records a new outstanding reader against lf. Callers must
+// hold the Store's mu, which also serializes calls to retire.
+func (lf *localFile) acquire() {
+	lf.mu.Lock()
+	lf.refs++
+	lf.mu.Unlock()
+}
+
+// release drops an outstanding reader against lf, closing and removing
+// its file once lf has been retired and every reader has released it.
+func (lf *localFile) release() error {
+	lf.mu.Lock()
+	lf.refs--
+	done := lf.retiring && lf.refs == 0
+	lf.mu.Unlock()
+
+	if !done {
+		return nil
+	}
+	if err := lf.f.Close(); err != nil {
+		return err
+	}
+	return os.Remove(lf.name)
+}
+
+// retire marks lf as no longer the active segment, closing and
+// removing its file immediately if there are no outstanding readers,
+// or leaving that to the last reader's release otherwise.
+func (lf *localFile) retire() error {
+	lf.mu.Lock()
+	lf.retiring = true
+	done := lf.refs == 0
+	lf.mu.Unlock()
+
+	if !done {
+		return nil
+	}
+	if err := lf.f.Close(); err != nil {
+		return err
+	}
+	return os.Remove(lf.name)
+}
+
+// releasingReader wraps a reader over the active segment's file with a
+// Close that releases the caller's hold on it via release, so
+// rotateLocked knows when it's safe to close and remove the file.
+type releasingReader struct {
+	io.Reader
+	release func() error
+}
+
+func (r *releasingReader) Close() error {
+	return r.release()
+}
+
+// Store buffers the active segment in a local scratch file and, once
+// it reaches SegmentMaxBytes, flushes it to the Uploader as one
+// immutable object and starts a new, empty segment.
+type Store struct {
+	mu sync.Mutex
+
+	up        Uploader
+	keyPrefix string
+
+	segmentMaxBytes int64
+	segments        []segment
+
+	local     *localFile
+	localBuf  *bufio.Writer
+	localBase uint64
+	localSize int64
+	dirty     bool
+
+	opts     log.StoreOptions
+	closeCh  chan struct{}
+	closedWg sync.WaitGroup
+}
+
+var _ log.Store = (*Store)(nil)
+
+// NewStore creates a store that flushes finished segments to up as
+// objects named "<keyPrefix>-<segment base offset>". It reloads any
+// segments a previous process already flushed under keyPrefix from
+// their persisted manifest object, so rotation keeps numbering new
+// segments (and their object keys) from where that process left off
+// instead of starting over and overwriting them. It applies opts'
+// sync and record size policy to the active, not-yet-flushed segment.
+func NewStore(up Uploader, keyPrefix string, segmentMaxBytes int64, opts log.StoreOptions) (*Store, error) {
+	segments, err := loadManifest(up, keyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	local, err := newLocalFile()
+	if err != nil {
+		return nil, err
+	}
+
+	var localBase uint64
+	if n := len(segments); n > 0 {
+		localBase = segments[n-1].base + uint64(segments[n-1].size)
+	}
+
+	s := &Store{
+		up:              up,
+		keyPrefix:       keyPrefix,
+		segmentMaxBytes: segmentMaxBytes,
+		segments:        segments,
+		local:           local,
+		localBuf:        bufio.NewWriter(local.f),
+		localBase:       localBase,
+		opts:            opts,
+	}
+
+	if opts.AutoSync > 0 {
+		s.closeCh = make(chan struct{})
+		s.closedWg.Add(1)
+		go s.autoSync()
+	}
+
+	return s, nil
+}
+
+// autoSync flushes and syncs the active segment on opts.AutoSync,
+// skipping a tick if nothing was appended since the last one.
+func (s *Store) autoSync() {
+	defer s.closedWg.Done()
+
+	ticker := time.NewTicker(s.opts.AutoSync)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.dirty {
+				s.flushAndSyncLocked()
+			}
+			s.mu.Unlock()
+		case <-s.closeCh:
+			return
+		}
+	}
+}
+
+// flushAndSyncLocked flushes the buffered writer and fsyncs the active
+// segment's local file. Callers must hold s.mu.
+func (s *Store) flushAndSyncLocked() error {
+	if err := s.localBuf.Flush(); err != nil {
+		return err
+	}
+	if err := s.local.f.Sync(); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// Append persists the given bytes to the store.
+// It returns the number of bytes written and the position where the store
+// holds the record.
+func (s *Store) Append(p []byte) (n uint64, pos uint64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.appendLocked(p)
+}
+
+// appendLocked writes the length-prefixed record to the active
+// segment and rotates it out to the uploader if it has reached
+// segmentMaxBytes. Callers must hold s.mu.
+func (s *Store) appendLocked(p []byte) (n uint64, pos uint64, err error) {
+	if err := log.CheckRecordSize(uint64(len(p)), s.opts.RecordSizeLimit); err != nil {
+		return 0, 0, err
+	}
+
+	pos = s.localBase + uint64(s.localSize)
+
+	header := make([]byte, log.LenWidth)
+	log.Enc.PutUint64(header, uint64(len(p)))
+	if _, err := s.localBuf.Write(header); err != nil {
+		return 0, 0, err
+	}
+	if _, err := s.localBuf.Write(p); err != nil {
+		return 0, 0, err
+	}
+
+	w := int64(log.LenWidth + len(p))
+	s.localSize += w
+	s.dirty = true
+
+	if s.localSize >= s.segmentMaxBytes {
+		if err := s.rotateLocked(); err != nil {
+			return 0, 0, err
+		}
+	} else if s.opts.SyncOnAppend {
+		if err := s.flushAndSyncLocked(); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return uint64(w), pos, nil
+}
+
+// appendStreamLocked writes the length-prefixed record to the active
+// segment, copying size bytes from r instead of taking a []byte the
+// way appendLocked does, so a staged record can be streamed straight
+// from its scratch file without ever holding the whole thing in
+// memory, and rotates the segment out if it has now reached
+// segmentMaxBytes. Callers must hold s.mu.
+func (s *Store) appendStreamLocked(size uint64, r io.Reader) (n uint64, pos uint64, err error) {
+	if err := log.CheckRecordSize(size, s.opts.RecordSizeLimit); err != nil {
+		return 0, 0, err
+	}
+
+	pos = s.localBase + uint64(s.localSize)
+
+	header := make([]byte, log.LenWidth)
+	log.Enc.PutUint64(header, size)
+	if _, err := s.localBuf.Write(header); err != nil {
+		return 0, 0, err
+	}
+
+	written, err := io.CopyN(s.localBuf, r, int64(size))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	w := int64(log.LenWidth) + written
+	s.localSize += w
+	s.dirty = true
+
+	if s.localSize >= s.segmentMaxBytes {
+		if err := s.rotateLocked(); err != nil {
+			return 0, 0, err
+		}
+	} else if s.opts.SyncOnAppend {
+		if err := s.flushAndSyncLocked(); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return uint64(w), pos, nil
+}
+
+// rotateLocked flushes the active segment to the uploader as one
+// immutable object and starts a new, empty segment. Callers must hold
+// s.mu.
+func (s *Store) rotateLocked() error {
+	if err := s.localBuf.Flush(); err != nil {
+		return err
+	}
+	if _, err := s.local.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("%s-%d", s.keyPrefix, s.localBase)
+	if err := s.up.PutObject(key, s.local.f, s.localSize); err != nil {
+		return err
+	}
+	s.segments = append(s.segments, segment{key: key, base: s.localBase, size: s.localSize})
+
+	manifest := encodeManifest(s.segments)
+	if err := s.up.PutObject(manifestKey(s.keyPrefix), bytes.NewReader(manifest), int64(len(manifest))); err != nil {
+		return err
+	}
+
+	local, err := newLocalFile()
+	if err != nil {
+		return err
+	}
+	retiring := s.local
+	s.local = local
+	s.localBuf = bufio.NewWriter(local.f)
+	s.localBase += uint64(s.localSize)
+	s.localSize = 0
+	s.dirty = false
+
+	// An OpenRecord caller may still be reading from the file we just
+	// rotated out; retire defers closing and removing it until every
+	// such reader releases it, instead of invalidating them here.
+	return retiring.retire()
+}
+
+// Read returns the record stored at the given position.
+func (s *Store) Read(pos uint64) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size, err := s.recordSizeLocked(pos)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, size)
+	if _, err := s.readBodyLocked(pos, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// RecordSize returns the length of the record stored at pos, whether
+// it lives in the active segment or an already-flushed one, without
+// reading its body.
+func (s *Store) RecordSize(pos uint64) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.recordSizeLocked(pos)
+}
+
+// recordSizeLocked returns the length of the record stored at pos.
+// Callers must hold s.mu.
+func (s *Store) recordSizeLocked(pos uint64) (uint64, error) {
+	if pos >= s.localBase {
+		if err := s.localBuf.Flush(); err != nil {
+			return 0, err
+		}
+		size := make([]byte, log.LenWidth)
+		if _, err := s.local.f.ReadAt(size, int64(pos-s.localBase)); err != nil {
+			return 0, err
+		}
+		return log.Enc.Uint64(size), nil
+	}
+
+	seg, err := s.findSegmentLocked(pos)
+	if err != nil {
+		return 0, err
+	}
+	size, err := s.getRangeLocked(seg.key, int64(pos-seg.base), log.LenWidth)
+	if err != nil {
+		return 0, err
+	}
+	return log.Enc.Uint64(size), nil
+}
+
+// readBodyLocked reads a record's body (not its length prefix) into
+// dst, which must already be sized to the record's length. Callers
+// must hold s.mu.
+func (s *Store) readBodyLocked(pos uint64, dst []byte) (int, error) {
+	if pos >= s.localBase {
+		off := int64(pos - s.localBase)
+		return s.local.f.ReadAt(dst, off+log.LenWidth)
+	}
+
+	seg, err := s.findSegmentLocked(pos)
+	if err != nil {
+		return 0, err
+	}
+	off := int64(pos - seg.base)
+	r, err := s.up.GetObjectRange(seg.key, off+log.LenWidth, int64(len(dst)))
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	return io.ReadFull(r, dst)
+}
+
+// ReadInto reads the record stored at pos into dst, which must be at
+// least as large as the record, rather than allocating a fresh slice
+// on every call the way Read does.
+func (s *Store) ReadInto(pos uint64, dst []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size, err := s.recordSizeLocked(pos)
+	if err != nil {
+		return 0, err
+	}
+	if uint64(len(dst)) < size {
+		return 0, io.ErrShortBuffer
+	}
+
+	return s.readBodyLocked(pos, dst[:size])
+}
+
+// OpenRecord returns a log.RecordReader that streams the record stored
+// at pos, reading straight from the local scratch file if it's still
+// in the active segment, or issuing a single ranged GetObjectRange
+// request if it's already been flushed. A reader returned for the
+// active segment holds a reference on its backing file (released by
+// the RecordReader's Close) so a concurrent rotation can't close and
+// remove the file out from under it.
+func (s *Store) OpenRecord(pos uint64) (*log.RecordReader, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size, err := s.recordSizeLocked(pos)
+	if err != nil {
+		return nil, err
+	}
+
+	if pos >= s.localBase {
+		if err := s.localBuf.Flush(); err != nil {
+			return nil, err
+		}
+		lf := s.local
+		lf.acquire()
+		off := int64(pos - s.localBase)
+		sr := io.NewSectionReader(lf.f, off+log.LenWidth, int64(size))
+		return log.NewRecordReader(&releasingReader{Reader: sr, release: lf.release}, size), nil
+	}
+
+	seg, err := s.findSegmentLocked(pos)
+	if err != nil {
+		return nil, err
+	}
+	off := int64(pos - seg.base)
+	r, err := s.up.GetObjectRange(seg.key, off+log.LenWidth, int64(size))
+	if err != nil {
+		return nil, err
+	}
+	return log.NewRecordReader(r, size), nil
+}
+
+// ReadAt reads len(p) bytes into "p" beginning at the "off" offset,
+// treating the store's segments as one contiguous file.
+func (s *Store) ReadAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if uint64(off) >= s.localBase {
+		if err := s.localBuf.Flush(); err != nil {
+			return 0, err
+		}
+		return s.local.f.ReadAt(p, off-int64(s.localBase))
+	}
+
+	seg, err := s.findSegmentLocked(uint64(off))
+	if err != nil {
+		return 0, err
+	}
+	b, err := s.getRangeLocked(seg.key, off-int64(seg.base), int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	return copy(p, b), nil
+}
+
+// findSegmentLocked returns the flushed segment that contains pos.
+// Callers must hold s.mu.
+func (s *Store) findSegmentLocked(pos uint64) (segment, error) {
+	for _, seg := range s.segments {
+		if pos >= seg.base && pos < seg.base+uint64(seg.size) {
+			return seg, nil
+		}
+	}
+	return segment{}, fmt.Errorf("s3 store: no segment covers position %d", pos)
+}
+
+// getRangeLocked reads length bytes starting at offset from the
+// flushed object named key. Callers must hold s.mu.
+func (s *Store) getRangeLocked(key string, offset, length int64) ([]byte, error) {
+	r, err := s.up.GetObjectRange(key, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	b := make([]byte, length)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Close flushes the active segment's buffered writes to its local
+// scratch file, without syncing it or rotating it to the uploader,
+// then closes that file.
+// A later NewStore against the same uploader and keyPrefix reloads
+// the persisted manifest and resumes appending after the last rotated
+// segment; records appended since that rotation, which never made it
+// past this process's local scratch file, do not survive the
+// restart.
+func (s *Store) Close() error {
+	if s.closeCh != nil {
+		close(s.closeCh)
+		s.closedWg.Wait()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.localBuf.Flush(); err != nil {
+		return err
+	}
+	return s.local.f.Close()
+}
+
+// NewWriter returns a log.StoreWriter that stages a new record's bytes
+// in a scratch file until the caller calls Commit.
+func (s *Store) NewWriter() (log.StoreWriter, error) {
+	return log.NewScratchWriter("s3store-upload-*", s.commitStaged)
+}
+
+// commitStaged is the log.CommitFunc backing NewWriter's ScratchWriter:
+// it locks s.mu and streams size bytes from r into the active segment
+// as one record, following the same lock-then-appendXLocked pattern
+// Append does.
+func (s *Store) commitStaged(size int64, r io.Reader) (n uint64, pos uint64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.appendStreamLocked(uint64(size), r)
+}
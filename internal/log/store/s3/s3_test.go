@@ -0,0 +1,389 @@
+package s3
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/mroobert/proglog/internal/log"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+var (
+	write = []byte("hello world")
+	width = uint64(len(write)) + log.LenWidth
+)
+
+// fakeUploader is an in-memory Uploader, so tests can exercise segment
+// flushing and ranged reads without touching a real object store.
+type fakeUploader struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeUploader() *fakeUploader {
+	return &fakeUploader{objects: make(map[string][]byte)}
+}
+
+func (u *fakeUploader) PutObject(key string, r io.Reader, size int64) error {
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	u.objects[key] = b
+	u.mu.Unlock()
+	return nil
+}
+
+func (u *fakeUploader) GetObjectRange(key string, offset, length int64) (io.ReadCloser, error) {
+	u.mu.Lock()
+	b, ok := u.objects[key]
+	u.mu.Unlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	// Mirror S3's own range semantics: a length that runs past the end
+	// of the object is clamped rather than rejected, so a caller that
+	// doesn't know an object's exact size up front (loadManifest, for
+	// one) can still ask for "up to N bytes".
+	end := offset + length
+	if end > int64(len(b)) {
+		end = int64(len(b))
+	}
+	return io.NopCloser(bytes.NewReader(b[offset:end])), nil
+}
+
+var _ Uploader = (*fakeUploader)(nil)
+
+func TestStore(t *testing.T) {
+	t.Run("testAppendRead", testAppendRead)
+	t.Run("testRotation", testRotation)
+	t.Run("testRestart", testRestart)
+}
+
+func testAppendRead(t *testing.T) {
+	s, err := NewStore(newFakeUploader(), "test", 1<<20, log.StoreOptions{})
+	if err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error when creating a store: %s", failed, err.Error())
+	}
+
+	t.Log("Given the need to append and read records from the active segment.")
+	{
+		var pos uint64
+		for i := uint64(1); i < 4; i++ {
+			t.Logf("\t\tTest %d:\t When appending and reading back a record:", i)
+			{
+				n, appendPos, err := s.Append(write)
+				if err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error: %s", failed, err.Error())
+				}
+				if appendPos+n != width*i {
+					t.Fatalf("\t\t\t%s Should expect record to be appended.", failed)
+				}
+				t.Logf("\t\t\t%s Should expect record to be appended.", success)
+
+				read, err := s.Read(pos)
+				if err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error: %s", failed, err.Error())
+				}
+				if bytes.Compare(write, read) != 0 {
+					t.Fatalf("\t\t\t%s Should expect: \"%s\" got: \"%s\"", failed, string(write), string(read))
+				}
+				t.Logf("\t\t\t%s Should read the expected record.", success)
+
+				size, err := s.RecordSize(pos)
+				if err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error: %s", failed, err.Error())
+				}
+				dst := make([]byte, size)
+				n2, err := s.ReadInto(pos, dst)
+				if err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error: %s", failed, err.Error())
+				}
+				if bytes.Compare(write, dst[:n2]) != 0 {
+					t.Fatalf("\t\t\t%s Should expect: \"%s\" got: \"%s\"", failed, string(write), string(dst[:n2]))
+				}
+				t.Logf("\t\t\t%s Should read the expected record into dst.", success)
+
+				rr, err := s.OpenRecord(pos)
+				if err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error opening the record: %s", failed, err.Error())
+				}
+				var buf bytes.Buffer
+				if _, err := rr.WriteTo(&buf); err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error writing it out: %s", failed, err.Error())
+				}
+				if err := rr.Close(); err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error closing the reader: %s", failed, err.Error())
+				}
+				if bytes.Compare(write, buf.Bytes()) != 0 {
+					t.Fatalf("\t\t\t%s Should expect: \"%s\" got: \"%s\"", failed, string(write), buf.String())
+				}
+				t.Logf("\t\t\t%s Should stream the same record out via OpenRecord.", success)
+
+				pos += width
+			}
+		}
+	}
+}
+
+// testRotation uses a segmentMaxBytes equal to a single record's width,
+// so every Append rotates the segment it just wrote out to the
+// uploader, exercising the flushed-segment read path for Read,
+// ReadInto and OpenRecord.
+func testRotation(t *testing.T) {
+	s, err := NewStore(newFakeUploader(), "test", int64(width), log.StoreOptions{})
+	if err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error when creating a store: %s", failed, err.Error())
+	}
+
+	t.Log("Given the need to flush a full segment to the uploader and keep serving it.")
+	{
+		var positions []uint64
+		for i := uint64(1); i < 4; i++ {
+			t.Logf("\t\tTest %d:\t When appending a record that fills the segment:", i)
+			{
+				n, pos, err := s.Append(write)
+				if err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error: %s", failed, err.Error())
+				}
+				if n != width {
+					t.Fatalf("\t\t\t%s Should expect %d bytes written, got %d", failed, width, n)
+				}
+				t.Logf("\t\t\t%s Should expect no error.", success)
+				positions = append(positions, pos)
+			}
+		}
+
+		if len(s.segments) != 3 {
+			t.Fatalf("\t\t\t%s Should expect every record to have flushed its own segment, got %d segments", failed, len(s.segments))
+		}
+		t.Logf("\t\t\t%s Should expect every full segment to have been flushed to the uploader.", success)
+
+		for i, pos := range positions {
+			t.Logf("\t\tTest %d:\t When reading a flushed record back:", i+1)
+			{
+				read, err := s.Read(pos)
+				if err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error: %s", failed, err.Error())
+				}
+				if bytes.Compare(write, read) != 0 {
+					t.Fatalf("\t\t\t%s Should expect: \"%s\" got: \"%s\"", failed, string(write), string(read))
+				}
+				t.Logf("\t\t\t%s Should read the expected record from its flushed segment.", success)
+
+				rr, err := s.OpenRecord(pos)
+				if err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error opening the record: %s", failed, err.Error())
+				}
+				var buf bytes.Buffer
+				if _, err := rr.WriteTo(&buf); err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error writing it out: %s", failed, err.Error())
+				}
+				if err := rr.Close(); err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error closing the reader: %s", failed, err.Error())
+				}
+				if bytes.Compare(write, buf.Bytes()) != 0 {
+					t.Fatalf("\t\t\t%s Should expect: \"%s\" got: \"%s\"", failed, string(write), buf.String())
+				}
+				t.Logf("\t\t\t%s Should stream the same record out of the flushed segment via OpenRecord.", success)
+			}
+		}
+	}
+}
+
+// testRestart simulates a process restart: it closes a store that has
+// rotated a segment out to the uploader, then opens a fresh Store
+// against the same uploader and key prefix and checks that the
+// rotated record is still readable and that the new store's first
+// rotation doesn't reuse (and overwrite) the old segment's key.
+func testRestart(t *testing.T) {
+	up := newFakeUploader()
+
+	s, err := NewStore(up, "restart", int64(width), log.StoreOptions{})
+	if err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error when creating a store: %s", failed, err.Error())
+	}
+
+	t.Log("Given the need to survive a process restart without losing or overwriting flushed segments.")
+	{
+		testID := 1
+		t.Logf("\t\tTest %d:\t When a record rotates a segment out before the process restarts:", testID)
+		{
+			_, pos, err := s.Append(write)
+			if err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error appending: %s", failed, err.Error())
+			}
+			if len(s.segments) != 1 {
+				t.Fatalf("\t\t\t%s Should expect the record to have rotated out its own segment, got %d segments", failed, len(s.segments))
+			}
+			if err := s.Close(); err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error closing the store: %s", failed, err.Error())
+			}
+			t.Logf("\t\t\t%s Should expect no error flushing and closing.", success)
+
+			restarted, err := NewStore(up, "restart", int64(width), log.StoreOptions{})
+			if err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error reopening the store: %s", failed, err.Error())
+			}
+			if len(restarted.segments) != 1 || restarted.localBase != s.localBase {
+				t.Fatalf("\t\t\t%s Should expect the reopened store to reload the prior segment index and localBase.", failed)
+			}
+			t.Logf("\t\t\t%s Should expect the reopened store to reload the prior segment index.", success)
+
+			read, err := restarted.Read(pos)
+			if err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error reading the pre-restart record: %s", failed, err.Error())
+			}
+			if bytes.Compare(write, read) != 0 {
+				t.Fatalf("\t\t\t%s Should expect: \"%s\" got: \"%s\"", failed, string(write), string(read))
+			}
+			t.Logf("\t\t\t%s Should read the pre-restart record back after the restart.", success)
+
+			oldKey := restarted.segments[0].key
+			if _, _, err := restarted.Append(write); err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error appending after restart: %s", failed, err.Error())
+			}
+			if len(restarted.segments) != 2 || restarted.segments[1].key == oldKey {
+				t.Fatalf("\t\t\t%s Should expect the post-restart rotation to flush a new segment key, not reuse the old one.", failed)
+			}
+			t.Logf("\t\t\t%s Should expect the post-restart rotation to flush under a new, non-colliding key.", success)
+
+			preRestartRead, err := restarted.Read(pos)
+			if err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error: %s", failed, err.Error())
+			}
+			if bytes.Compare(write, preRestartRead) != 0 {
+				t.Fatalf("\t\t\t%s Should expect the pre-restart segment to still be intact: \"%s\" got: \"%s\"", failed, string(write), string(preRestartRead))
+			}
+			t.Logf("\t\t\t%s Should expect the pre-restart segment to still be intact, not overwritten.", success)
+		}
+	}
+}
+
+func TestStoreWriter(t *testing.T) {
+	t.Run("testWriterCommit", testWriterCommit)
+	t.Run("testWriterCancel", testWriterCancel)
+}
+
+func testWriterCommit(t *testing.T) {
+	s, err := NewStore(newFakeUploader(), "test", 1<<20, log.StoreOptions{})
+	if err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error when creating a store: %s", failed, err.Error())
+	}
+
+	t.Log("Given the need to stream a record into the store in chunks.")
+	{
+		testID := 1
+		t.Logf("\t\tTest %d:\t When writing chunks and committing:", testID)
+		{
+			w, err := s.NewWriter()
+			if err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error when creating a writer: %s", failed, err.Error())
+			}
+
+			for _, chunk := range bytes.SplitAfter(write, []byte(" ")) {
+				if _, err := w.Write(chunk); err != nil {
+					t.Fatalf("\t\t\t%s Should expect no error when writing a chunk: %s", failed, err.Error())
+				}
+			}
+			if w.Size() != int64(len(write)) {
+				t.Fatalf("\t\t\t%s Should expect the staged size to match the written bytes.", failed)
+			}
+			t.Logf("\t\t\t%s Should expect the staged size to match the written bytes.", success)
+
+			n, pos, err := w.Commit()
+			if err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error when committing: %s", failed, err.Error())
+			}
+			t.Logf("\t\t\t%s Should expect no error when committing.", success)
+
+			if n != width || pos != 0 {
+				t.Fatalf("\t\t\t%s Should expect the committed record to be appended as a single record.", failed)
+			}
+			t.Logf("\t\t\t%s Should expect the committed record to be appended as a single record.", success)
+
+			read, err := s.Read(pos)
+			if err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error when reading back the record: %s", failed, err.Error())
+			}
+			if bytes.Compare(write, read) != 0 {
+				t.Fatalf("\t\t\t%s Should expect: \"%s\" got: \"%s\"", failed, string(write), string(read))
+			}
+			t.Logf("\t\t\t%s Should read back the committed record.", success)
+		}
+	}
+}
+
+func testWriterCancel(t *testing.T) {
+	s, err := NewStore(newFakeUploader(), "test", 1<<20, log.StoreOptions{})
+	if err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error when creating a store: %s", failed, err.Error())
+	}
+
+	t.Log("Given the need to abandon a partially staged record.")
+	{
+		testID := 1
+		t.Logf("\t\tTest %d:\t When cancelling a writer:", testID)
+		{
+			w, err := s.NewWriter()
+			if err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error when creating a writer: %s", failed, err.Error())
+			}
+			if _, err := w.Write(write); err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error when writing: %s", failed, err.Error())
+			}
+
+			if err := w.Cancel(); err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error when cancelling: %s", failed, err.Error())
+			}
+			t.Logf("\t\t\t%s Should expect no error when cancelling.", success)
+
+			if s.localSize != 0 {
+				t.Fatalf("\t\t\t%s Should expect nothing to have been appended to the store.", failed)
+			}
+			t.Logf("\t\t\t%s Should expect nothing to have been appended to the store.", success)
+		}
+	}
+}
+
+func TestStoreOptions(t *testing.T) {
+	t.Run("testRecordSizeLimit", testRecordSizeLimit)
+}
+
+func testRecordSizeLimit(t *testing.T) {
+	s, err := NewStore(newFakeUploader(), "test", 1<<20, log.StoreOptions{RecordSizeLimit: uint64(len(write)) - 1})
+	if err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error when creating a store: %s", failed, err.Error())
+	}
+
+	t.Log("Given the need to reject records larger than the configured limit.")
+	{
+		testID := 1
+		t.Logf("\t\tTest %d:\t When appending a record over the limit:", testID)
+		{
+			_, _, err := s.Append(write)
+
+			var tooLarge *log.RecordTooLargeError
+			if !errors.As(err, &tooLarge) {
+				t.Fatalf("\t\t\t%s Should expect a *log.RecordTooLargeError, got: %v", failed, err)
+			}
+			t.Logf("\t\t\t%s Should expect a *log.RecordTooLargeError.", success)
+
+			if s.localSize != 0 {
+				t.Fatalf("\t\t\t%s Should expect nothing to have been written to the store.", failed)
+			}
+			t.Logf("\t\t\t%s Should expect nothing to have been written to the store.", success)
+		}
+	}
+}
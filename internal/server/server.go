@@ -0,0 +1,368 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mroobert/proglog/internal/log"
+	"github.com/mroobert/proglog/internal/log/store/file"
+	"github.com/mroobert/proglog/internal/log/store/inmemory"
+)
+
+// dataFile is where the server persists its log store when it's
+// configured to use the file driver.
+const dataFile = "proglog.store"
+
+// storeDriverEnv names the environment variable that picks which
+// log.Store implementation the server runs against. It defaults to
+// "file". The "s3" driver needs an Uploader wired up with real
+// credentials and a bucket, so it isn't selectable here; deployments
+// that want it construct an s3.Store directly and build an httpServer
+// around it.
+const storeDriverEnv = "PROGLOG_STORE_DRIVER"
+
+// Environment variables that configure the store's sync and record
+// size policy, mirrored onto a log.StoreOptions. Unset means the
+// log.StoreOptions zero value: no limit, no background syncing.
+const (
+	autoSyncEnv        = "PROGLOG_STORE_AUTO_SYNC"
+	syncOnAppendEnv    = "PROGLOG_STORE_SYNC_ON_APPEND"
+	recordSizeLimitEnv = "PROGLOG_STORE_RECORD_SIZE_LIMIT"
+)
+
+// httpServer exposes the log store over HTTP. Besides accepting whole
+// records, it offers a resumable, chunked upload API so producers can
+// stream records too large to hold in memory and pick a disconnected
+// upload back up without leaving partial framing in the store file.
+type httpServer struct {
+	store log.Store
+
+	mu      sync.Mutex
+	uploads map[string]log.StoreWriter
+
+	// readBufPool lets GET handlers reuse read buffers across requests
+	// instead of allocating one per record the way store.Read does.
+	readBufPool sync.Pool
+}
+
+// readBufSize is the size a pooled read buffer starts at. Records that
+// don't fit are served by streaming them out with OpenRecord instead
+// of growing (and keeping) an oversized buffer in the pool.
+const readBufSize = 4096
+
+// NewHttpServer builds an *http.Server that serves the log store's
+// HTTP API at the given address.
+func NewHttpServer(addr string) *http.Server {
+	srv, err := newHttpServer()
+	if err != nil {
+		// The store file is opened eagerly so a misconfigured data
+		// directory fails fast at startup rather than on the first
+		// request.
+		panic(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/records", srv.handleRecords)
+	mux.HandleFunc("/records/", srv.handleRecord)
+
+	return &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+}
+
+func newHttpServer() (*httpServer, error) {
+	store, err := newStore()
+	if err != nil {
+		return nil, err
+	}
+
+	return &httpServer{
+		store:   store,
+		uploads: make(map[string]log.StoreWriter),
+		readBufPool: sync.Pool{
+			New: func() interface{} {
+				b := make([]byte, readBufSize)
+				return &b
+			},
+		},
+	}, nil
+}
+
+// newStore builds the log.Store named by storeDriverEnv, opening
+// whatever backing resources that driver needs and applying the sync
+// and record size policy read from the environment.
+func newStore() (log.Store, error) {
+	opts, err := storeOptionsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	switch driver := os.Getenv(storeDriverEnv); driver {
+	case "", "file":
+		f, err := os.OpenFile(dataFile, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return file.NewStore(f, opts)
+	case "inmemory":
+		return inmemory.NewStore(opts), nil
+	default:
+		return nil, fmt.Errorf("server: unknown %s %q", storeDriverEnv, driver)
+	}
+}
+
+// storeOptionsFromEnv builds the log.StoreOptions the store is
+// constructed with from autoSyncEnv, syncOnAppendEnv and
+// recordSizeLimitEnv.
+func storeOptionsFromEnv() (log.StoreOptions, error) {
+	var opts log.StoreOptions
+
+	if v := os.Getenv(autoSyncEnv); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return opts, fmt.Errorf("server: invalid %s %q: %w", autoSyncEnv, v, err)
+		}
+		opts.AutoSync = d
+	}
+
+	if v := os.Getenv(syncOnAppendEnv); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("server: invalid %s %q: %w", syncOnAppendEnv, v, err)
+		}
+		opts.SyncOnAppend = b
+	}
+
+	if v := os.Getenv(recordSizeLimitEnv); v != "" {
+		limit, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return opts, fmt.Errorf("server: invalid %s %q: %w", recordSizeLimitEnv, v, err)
+		}
+		opts.RecordSizeLimit = limit
+	}
+
+	return opts, nil
+}
+
+// handleRecords starts a new chunked upload and hands back its ID. A
+// POST that names an upload already in progress (a client retrying
+// because it never saw the original 201) is idempotent: it hands back
+// the same ID instead of replacing the upload's staged writer, which
+// would silently discard whatever chunks were already appended and
+// leak its scratch file.
+func (s *httpServer) handleRecords(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("upload")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id != "" {
+		if _, exists := s.uploads[id]; exists {
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{"upload_id": id})
+			return
+		}
+	} else {
+		id = newUploadID()
+	}
+
+	writer, err := s.store.NewWriter()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.uploads[id] = writer
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"upload_id": id})
+}
+
+// handleRecord dispatches the operations that act on a single record
+// or upload: fetching a committed record (GET, where id is its store
+// position), appending a chunk to an in-progress upload (PATCH), and
+// finalizing one (PUT, where id is the upload ID in both cases).
+func (s *httpServer) handleRecord(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/records/")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.handleGetRecord(w, r, id)
+	case http.MethodPatch:
+		s.handleAppendChunk(w, r, id)
+	case http.MethodPut:
+		s.handleCommit(w, r, id)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleGetRecord writes out the record stored at the position named
+// by id. For the common case it sizes a pooled buffer with RecordSize
+// and reads straight into it with ReadInto, so serving a record needs
+// no per-request buffer for its body. A record bigger than readBufSize
+// is instead
+// streamed out via OpenRecord/WriteTo, so a single oversized record
+// doesn't grow the pool's buffer (and keep it around) for every future
+// request.
+func (s *httpServer) handleGetRecord(w http.ResponseWriter, r *http.Request, id string) {
+	pos, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid record position", http.StatusBadRequest)
+		return
+	}
+
+	size, err := s.store.RecordSize(pos)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if size > uint64(readBufSize) {
+		rr, err := s.store.OpenRecord(pos)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		defer rr.Close()
+
+		if _, err := rr.WriteTo(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	bufPtr := s.readBufPool.Get().(*[]byte)
+	defer s.readBufPool.Put(bufPtr)
+
+	buf := (*bufPtr)[:size]
+	n, err := s.store.ReadInto(pos, buf)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(buf[:n])
+}
+
+// handleAppendChunk appends the request body to the named upload. The
+// Content-Range header tells us where the client thinks this chunk
+// starts, so a resumed client that repeats or skips a chunk is caught
+// instead of silently corrupting the record.
+func (s *httpServer) handleAppendChunk(w http.ResponseWriter, r *http.Request, id string) {
+	s.mu.Lock()
+	writer, ok := s.uploads[id]
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "unknown upload", http.StatusNotFound)
+		return
+	}
+
+	start, err := parseContentRangeStart(r.Header.Get("Content-Range"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if start != writer.Size() {
+		// The client's view of the upload has diverged from ours, most
+		// likely because an earlier chunk was dropped; tell it where
+		// we actually are so it can resume from there.
+		if rng := rangeHeaderValue(writer.Size()); rng != "" {
+			w.Header().Set("Range", rng)
+		}
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	if _, err := io.Copy(writer, r.Body); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if rng := rangeHeaderValue(writer.Size()); rng != "" {
+		w.Header().Set("Range", rng)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCommit finalizes the named upload, appending its staged bytes
+// to the store as a single record.
+func (s *httpServer) handleCommit(w http.ResponseWriter, r *http.Request, id string) {
+	s.mu.Lock()
+	writer, ok := s.uploads[id]
+	if ok {
+		delete(s.uploads, id)
+	}
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "unknown upload", http.StatusNotFound)
+		return
+	}
+
+	n, pos, err := writer.Commit()
+	if err != nil {
+		var tooLarge *log.RecordTooLargeError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]uint64{"pos": pos, "size": n})
+}
+
+// rangeHeaderValue formats how many bytes of an upload are staged so
+// far as a Range header value, or "" if none are staged yet, since
+// size-1 would underflow to "bytes=0--1" for an upload that hasn't
+// received its first chunk.
+func rangeHeaderValue(size int64) string {
+	if size == 0 {
+		return ""
+	}
+	return fmt.Sprintf("bytes=0-%d", size-1)
+}
+
+// parseContentRangeStart extracts the start offset from a
+// "bytes start-end/total" Content-Range header.
+func parseContentRangeStart(header string) (int64, error) {
+	if header == "" {
+		return 0, fmt.Errorf("missing Content-Range header")
+	}
+	header = strings.TrimPrefix(header, "bytes ")
+	dash := strings.Index(header, "-")
+	if dash < 0 {
+		return 0, fmt.Errorf("malformed Content-Range header: %q", header)
+	}
+	return strconv.ParseInt(header[:dash], 10, 64)
+}
+
+// newUploadID generates a random identifier for an upload that the
+// client didn't choose one for itself.
+func newUploadID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
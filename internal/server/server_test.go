@@ -0,0 +1,234 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func newTestServer(t *testing.T) *httpServer {
+	t.Helper()
+	t.Setenv(storeDriverEnv, "inmemory")
+
+	srv, err := newHttpServer()
+	if err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error when creating the server: %s", failed, err.Error())
+	}
+	return srv
+}
+
+// startUpload starts a new upload on srv and returns its upload ID.
+func startUpload(t *testing.T, srv *httpServer) string {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	srv.handleRecords(w, httptest.NewRequest(http.MethodPost, "/records", nil))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("\t\t\t%s Should expect %d starting an upload, got %d", failed, http.StatusCreated, w.Code)
+	}
+
+	var resp map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error decoding the upload ID: %s", failed, err.Error())
+	}
+	return resp["upload_id"]
+}
+
+// appendChunk PATCHes chunk onto the upload named id at offset start and
+// returns the response.
+func appendChunk(srv *httpServer, id string, chunk []byte, start int64) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, "/records/"+id, bytes.NewReader(chunk))
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/*", start, start+int64(len(chunk))-1))
+
+	w := httptest.NewRecorder()
+	srv.handleRecord(w, req)
+	return w
+}
+
+func TestHTTPServer(t *testing.T) {
+	t.Run("testUploadLifecycle", testUploadLifecycle)
+	t.Run("testResumeConflict", testResumeConflict)
+	t.Run("testRecordTooLarge", testRecordTooLarge)
+	t.Run("testStartUploadRetry", testStartUploadRetry)
+	t.Run("testResumeConflictAtStart", testResumeConflictAtStart)
+}
+
+func testUploadLifecycle(t *testing.T) {
+	srv := newTestServer(t)
+
+	t.Log("Given the need to stream a record into the store in chunks over HTTP.")
+	{
+		testID := 1
+		t.Logf("\t\tTest %d:\t When starting an upload, appending chunks and committing it:", testID)
+		{
+			id := startUpload(t, srv)
+
+			var start int64
+			for _, chunk := range [][]byte{[]byte("hello "), []byte("world")} {
+				if w := appendChunk(srv, id, chunk, start); w.Code != http.StatusNoContent {
+					t.Fatalf("\t\t\t%s Should expect %d appending a chunk, got %d: %s", failed, http.StatusNoContent, w.Code, w.Body.String())
+				}
+				start += int64(len(chunk))
+			}
+			t.Logf("\t\t\t%s Should expect every chunk to append without error.", success)
+
+			w := httptest.NewRecorder()
+			srv.handleRecord(w, httptest.NewRequest(http.MethodPut, "/records/"+id, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t\t\t%s Should expect %d committing, got %d: %s", failed, http.StatusOK, w.Code, w.Body.String())
+			}
+
+			var committed map[string]uint64
+			if err := json.NewDecoder(w.Body).Decode(&committed); err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error decoding the commit response: %s", failed, err.Error())
+			}
+			t.Logf("\t\t\t%s Should expect no error when committing.", success)
+
+			getW := httptest.NewRecorder()
+			srv.handleRecord(getW, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/records/%d", committed["pos"]), nil))
+			if getW.Code != http.StatusOK {
+				t.Fatalf("\t\t\t%s Should expect %d reading back the record, got %d", failed, http.StatusOK, getW.Code)
+			}
+			if getW.Body.String() != "hello world" {
+				t.Fatalf("\t\t\t%s Should expect: \"hello world\" got: %q", failed, getW.Body.String())
+			}
+			t.Logf("\t\t\t%s Should read back the committed record.", success)
+		}
+	}
+}
+
+func testResumeConflict(t *testing.T) {
+	srv := newTestServer(t)
+
+	t.Log("Given the need to resume an upload after a dropped acknowledgement.")
+	{
+		testID := 1
+		t.Logf("\t\tTest %d:\t When a chunk's Content-Range doesn't match where the upload actually is:", testID)
+		{
+			id := startUpload(t, srv)
+
+			if w := appendChunk(srv, id, []byte("hello"), 0); w.Code != http.StatusNoContent {
+				t.Fatalf("\t\t\t%s Should expect the first chunk to append cleanly, got %d", failed, w.Code)
+			}
+
+			// The client repeats the same chunk, as if it never saw our ack.
+			w := appendChunk(srv, id, []byte("hello"), 0)
+			if w.Code != http.StatusConflict {
+				t.Fatalf("\t\t\t%s Should expect %d on a diverged chunk, got %d", failed, http.StatusConflict, w.Code)
+			}
+			t.Logf("\t\t\t%s Should expect %d on a diverged chunk.", success, http.StatusConflict)
+
+			if rng := w.Header().Get("Range"); rng != "bytes=0-4" {
+				t.Fatalf("\t\t\t%s Should expect the Range header to point at where the upload actually is, got %q", failed, rng)
+			}
+			t.Logf("\t\t\t%s Should expect the Range header to point at where the upload actually is.", success)
+		}
+	}
+}
+
+func testRecordTooLarge(t *testing.T) {
+	t.Setenv(storeDriverEnv, "inmemory")
+	t.Setenv(recordSizeLimitEnv, "4")
+
+	srv, err := newHttpServer()
+	if err != nil {
+		t.Fatalf("\t\t\t%s Should expect no error when creating the server: %s", failed, err.Error())
+	}
+
+	t.Log("Given the need to reject a committed record over the configured size limit.")
+	{
+		testID := 1
+		t.Logf("\t\tTest %d:\t When committing an upload bigger than RecordSizeLimit:", testID)
+		{
+			id := startUpload(t, srv)
+
+			if w := appendChunk(srv, id, []byte("hello"), 0); w.Code != http.StatusNoContent {
+				t.Fatalf("\t\t\t%s Should expect the chunk to append cleanly, got %d", failed, w.Code)
+			}
+
+			w := httptest.NewRecorder()
+			srv.handleRecord(w, httptest.NewRequest(http.MethodPut, "/records/"+id, nil))
+			if w.Code != http.StatusRequestEntityTooLarge {
+				t.Fatalf("\t\t\t%s Should expect %d, got %d: %s", failed, http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+			}
+			t.Logf("\t\t\t%s Should expect %d when the committed record exceeds RecordSizeLimit.", success, http.StatusRequestEntityTooLarge)
+		}
+	}
+}
+
+func testStartUploadRetry(t *testing.T) {
+	srv := newTestServer(t)
+
+	t.Log("Given the need to tolerate a client retrying a start request whose response it never saw.")
+	{
+		testID := 1
+		t.Logf("\t\tTest %d:\t When a chunk is staged and the start request is repeated with the same upload id:", testID)
+		{
+			w := httptest.NewRecorder()
+			srv.handleRecords(w, httptest.NewRequest(http.MethodPost, "/records?upload=retry-me", nil))
+			if w.Code != http.StatusCreated {
+				t.Fatalf("\t\t\t%s Should expect %d starting the upload, got %d", failed, http.StatusCreated, w.Code)
+			}
+
+			if w := appendChunk(srv, "retry-me", []byte("hello"), 0); w.Code != http.StatusNoContent {
+				t.Fatalf("\t\t\t%s Should expect the chunk to stage cleanly, got %d", failed, w.Code)
+			}
+
+			retryW := httptest.NewRecorder()
+			srv.handleRecords(retryW, httptest.NewRequest(http.MethodPost, "/records?upload=retry-me", nil))
+			if retryW.Code != http.StatusCreated {
+				t.Fatalf("\t\t\t%s Should expect %d on the repeated start, got %d", failed, http.StatusCreated, retryW.Code)
+			}
+
+			var resp map[string]string
+			if err := json.NewDecoder(retryW.Body).Decode(&resp); err != nil {
+				t.Fatalf("\t\t\t%s Should expect no error decoding the repeated start's response: %s", failed, err.Error())
+			}
+			if resp["upload_id"] != "retry-me" {
+				t.Fatalf("\t\t\t%s Should expect the same upload ID back, got %q", failed, resp["upload_id"])
+			}
+			t.Logf("\t\t\t%s Should expect the repeated start to hand back the same upload ID.", success)
+
+			srv.mu.Lock()
+			staged := srv.uploads["retry-me"].Size()
+			srv.mu.Unlock()
+			if staged != int64(len("hello")) {
+				t.Fatalf("\t\t\t%s Should expect the already-staged chunk to survive the repeated start, got %d bytes staged", failed, staged)
+			}
+			t.Logf("\t\t\t%s Should expect the already-staged chunk to survive the repeated start.", success)
+		}
+	}
+}
+
+func testResumeConflictAtStart(t *testing.T) {
+	srv := newTestServer(t)
+
+	t.Log("Given the need to report a diverged chunk before any bytes have been staged.")
+	{
+		testID := 1
+		t.Logf("\t\tTest %d:\t When the very first chunk's Content-Range doesn't start at zero:", testID)
+		{
+			id := startUpload(t, srv)
+
+			w := appendChunk(srv, id, []byte("hello"), 5)
+			if w.Code != http.StatusConflict {
+				t.Fatalf("\t\t\t%s Should expect %d on a diverged first chunk, got %d", failed, http.StatusConflict, w.Code)
+			}
+			t.Logf("\t\t\t%s Should expect %d on a diverged first chunk.", success, http.StatusConflict)
+
+			if rng := w.Header().Get("Range"); rng != "" {
+				t.Fatalf("\t\t\t%s Should expect no Range header when nothing is staged yet, got %q", failed, rng)
+			}
+			t.Logf("\t\t\t%s Should expect no malformed Range header when nothing is staged yet.", success)
+		}
+	}
+}